@@ -2,10 +2,12 @@ package http2to1
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"fmt"
 	"log"
 	"net"
+	"os"
+	"sync"
 	"time"
 
 	"golang.org/x/net/http2"
@@ -16,8 +18,19 @@ var (
 	// connectionPreface is the constant value of the connection preface.
 	// https://tools.ietf.org/html/rfc7540#section-3.5
 	connectionPreface = []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+
+	// placeholderAddr is returned from LocalAddr/RemoteAddr before the
+	// upstream dial has completed, since the real addr isn't known yet.
+	placeholderAddr net.Addr = &net.TCPAddr{}
 )
 
+// defaultClientConnPool is shared by every H2AdaptorConn, so the
+// per-authority conn limit and idle eviction apply across all of them.
+// Streams of different H2AdaptorConns do not multiplex over one HTTP/2 conn:
+// each H2AdaptorConn that forwards its headers gets a conn of its own (see
+// pooledConn.primed).
+var defaultClientConnPool = NewClientConnPool(dialHTTP2Conn)
+
 type H2AdaptorConn struct {
 	// framer *http2.Framer
 	// w      *bufpipe.PipeWriter
@@ -27,8 +40,25 @@ type H2AdaptorConn struct {
 	peekBuf  *bytes.Buffer
 	writeBuf *bytes.Buffer
 
+	pool          *ClientConnPool
+	pooledConn    *pooledConn
 	h2conn        net.Conn
 	h2ConnCreated chan struct{}
+
+	// fingerprint selects which browser's ClientHello the upstream dial
+	// mimics. Defaults to FingerprintChrome (the zero value) until
+	// SetClientHelloJA3 is called with the JA3 observed on the client's own
+	// inbound ClientHello.
+	fingerprint Fingerprint
+
+	mu              sync.Mutex
+	closed          chan struct{}
+	closeOnce       sync.Once
+	readDeadline    time.Time
+	writeDeadline   time.Time
+	dialTimer       *time.Timer
+	dialTimedOut    chan struct{}
+	dialTimeoutOnce sync.Once
 }
 
 func NewH2AdaptorConn() net.Conn {
@@ -39,11 +69,22 @@ func NewH2AdaptorConn() net.Conn {
 		decoder:       hpack.NewDecoder(4096, nil),
 		peekBuf:       bytes.NewBuffer(nil),
 		writeBuf:      bytes.NewBuffer(nil),
+		pool:          defaultClientConnPool,
 		h2ConnCreated: make(chan struct{}),
+		closed:        make(chan struct{}),
+		dialTimedOut:  make(chan struct{}),
 	}
 	return c
 }
 
+// SetClientHelloJA3 records the JA3 fingerprint observed on the client's own
+// inbound ClientHello, so the upstream dial impersonates the same browser.
+// Call it (if known) before any bytes reach Write; it has no effect once
+// the upstream dial has already started.
+func (c *H2AdaptorConn) SetClientHelloJA3(ja3 string) {
+	c.fingerprint = FingerprintFromJA3(ja3)
+}
+
 /*
 	func (c *H2AdaptorConn) tryPeekServerInfo() ([]hpack.HeaderField, error) {
 		bufCopy := bytes.NewBuffer(c.peekBuf.Bytes())
@@ -126,7 +167,9 @@ func (c *H2AdaptorConn) onHeadersBuf(headersBuf []byte) error {
 		return fmt.Errorf("authority or scheme not found in headers")
 	}
 
-	h2conn, _, err := c.dialHTTP2Conn(authority, scheme)
+	ctx, cancel := c.dialContext()
+	defer cancel()
+	pc, err := c.pool.GetOrDial(ctx, authority, scheme, c.fingerprint)
 	if err != nil {
 		return err
 	}
@@ -134,32 +177,78 @@ func (c *H2AdaptorConn) onHeadersBuf(headersBuf []byte) error {
 	buf := bytes.NewBuffer(nil)
 	buf.Write(connectionPreface)
 	buf.Write(c.peekBuf.Bytes())
-	if _, err := h2conn.Write(buf.Bytes()); err != nil {
+	if _, err := pc.Write(buf.Bytes()); err != nil {
+		c.pool.Release(pc)
 		return err
 	}
-	// h2conn established
-	c.h2conn = h2conn
+	pc.markPrimed()
+
+	// Close may have already run while the dial above was in flight; at
+	// that point c.pooledConn was still nil, so Close had nothing to
+	// release. Re-check c.closed under c.mu before adopting pc so a conn
+	// checked out for an already-closed H2AdaptorConn is released back to
+	// the pool instead of leaked forever (it would otherwise never become
+	// idle, since nothing will ever release its one active stream).
+	c.mu.Lock()
+	select {
+	case <-c.closed:
+		c.mu.Unlock()
+		c.pool.Release(pc)
+		return net.ErrClosed
+	default:
+	}
+	c.pooledConn = pc
+	c.h2conn = pc
+	c.mu.Unlock()
+	c.applyBufferedDeadlines()
 	close(c.h2ConnCreated)
 	return nil
 }
 
-func (c *H2AdaptorConn) dialHTTP2Conn(host, scheme string) (net.Conn, string, error) {
-	protocolCh := make(chan string, 1)
-	tlsConfig := &tls.Config{
-		NextProtos: []string{"http/1.1", "h2"},
-		VerifyConnection: func(cs tls.ConnectionState) error {
-			log.Println("== tls connection NegotiatedProtocol:", cs.NegotiatedProtocol)
-			protocolCh <- cs.NegotiatedProtocol
-			return nil
-		},
-	}
-	tlsConn, err := tls.Dial("tcp", fmt.Sprintf("%s:443", host), tlsConfig)
+// dialContext bounds the upstream dial by the earliest read/write deadline
+// set on c so far, if any, so a deadline set before the dial completes
+// actually unblocks the dial itself rather than only unblocking Read via
+// dialTimedOut.
+func (c *H2AdaptorConn) dialContext() (context.Context, context.CancelFunc) {
+	c.mu.Lock()
+	deadline := c.readDeadline
+	if deadline.IsZero() || (!c.writeDeadline.IsZero() && c.writeDeadline.Before(deadline)) {
+		deadline = c.writeDeadline
+	}
+	c.mu.Unlock()
+
+	if deadline.IsZero() {
+		return context.Background(), func() {}
+	}
+	return context.WithDeadline(context.Background(), deadline)
+}
+
+// applyBufferedDeadlines replays any SetDeadline/SetReadDeadline/
+// SetWriteDeadline calls made before the dial completed, and cancels the
+// dial timeout timer now that there's a real conn to apply deadlines to.
+func (c *H2AdaptorConn) applyBufferedDeadlines() {
+	c.mu.Lock()
+	if c.dialTimer != nil {
+		c.dialTimer.Stop()
+	}
+	rd, wd := c.readDeadline, c.writeDeadline
+	c.mu.Unlock()
+
+	if !rd.IsZero() {
+		c.h2conn.SetReadDeadline(rd)
+	}
+	if !wd.IsZero() {
+		c.h2conn.SetWriteDeadline(wd)
+	}
+}
+
+func dialHTTP2Conn(ctx context.Context, host, scheme string, fp Fingerprint) (net.Conn, string, error) {
+	tlsConn, protocol, err := dialerForFingerprint(fp).DialTLS(ctx, host)
 	if err != nil {
 		return nil, "", err
 	}
+	log.Println("== tls connection NegotiatedProtocol:", protocol)
 	var h2conn net.Conn
-	// TODO: add timeout and failure handling
-	protocol := <-protocolCh
 	switch protocol {
 	case "h2":
 		h2conn = tlsConn
@@ -172,6 +261,12 @@ func (c *H2AdaptorConn) dialHTTP2Conn(host, scheme string) (net.Conn, string, er
 }
 
 func (c *H2AdaptorConn) Write(buf []byte) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+
 	// h2 preface
 	if bytes.Equal(buf, connectionPreface) {
 		return len(buf), nil
@@ -245,15 +340,114 @@ func (c *H2AdaptorConn) readFramesLoop() {
 }
 */
 
-func (c *H2AdaptorConn) Close() error         { return nil }
-func (c *H2AdaptorConn) LocalAddr() net.Addr  { panic("not implemented") }
-func (c *H2AdaptorConn) RemoteAddr() net.Addr { panic("not implemented") }
+// Close cancels any pending dial wait (so Read returns net.ErrClosed) and,
+// once a pooled conn was checked out, releases its stream capacity back to
+// the pool rather than tearing down the shared upstream conn.
+func (c *H2AdaptorConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+
+	c.mu.Lock()
+	if c.dialTimer != nil {
+		c.dialTimer.Stop()
+	}
+	pc := c.pooledConn
+	c.pooledConn = nil
+	c.mu.Unlock()
+
+	if pc != nil {
+		c.pool.Release(pc)
+	}
+	return nil
+}
+
+func (c *H2AdaptorConn) LocalAddr() net.Addr {
+	select {
+	case <-c.h2ConnCreated:
+		return c.h2conn.LocalAddr()
+	default:
+		return placeholderAddr
+	}
+}
+
+func (c *H2AdaptorConn) RemoteAddr() net.Addr {
+	select {
+	case <-c.h2ConnCreated:
+		return c.h2conn.RemoteAddr()
+	default:
+		return placeholderAddr
+	}
+}
+
+func (c *H2AdaptorConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+func (c *H2AdaptorConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	h2conn := c.h2conn
+	c.mu.Unlock()
+	if h2conn != nil {
+		return h2conn.SetReadDeadline(t)
+	}
+	c.armDialTimeout(t)
+	return nil
+}
+
+func (c *H2AdaptorConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	h2conn := c.h2conn
+	c.mu.Unlock()
+	if h2conn != nil {
+		return h2conn.SetWriteDeadline(t)
+	}
+	c.armDialTimeout(t)
+	return nil
+}
 
-func (c *H2AdaptorConn) SetDeadline(t time.Time) error      { panic("not implemented") }
-func (c *H2AdaptorConn) SetReadDeadline(t time.Time) error  { panic("not implemented") }
-func (c *H2AdaptorConn) SetWriteDeadline(t time.Time) error { panic("not implemented") }
+// armDialTimeout arranges for a pending Read (blocked waiting for the dial
+// to complete) to give up with os.ErrDeadlineExceeded once t passes, since
+// there's no real conn yet to hand the deadline to.
+func (c *H2AdaptorConn) armDialTimeout(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.dialTimer != nil {
+		c.dialTimer.Stop()
+	}
+	if t.IsZero() {
+		return
+	}
+	d := time.Until(t)
+	if d <= 0 {
+		c.fireDialTimeout()
+		return
+	}
+	c.dialTimer = time.AfterFunc(d, c.fireDialTimeout)
+}
 
+func (c *H2AdaptorConn) fireDialTimeout() {
+	c.dialTimeoutOnce.Do(func() {
+		close(c.dialTimedOut)
+	})
+}
+
+// TODO: Read still assumes this H2AdaptorConn owns the pooled conn
+// exclusively, so frames belonging to sibling streams sharing the same
+// pooledConn aren't demultiplexed here yet. Tracked as a follow-up once the
+// peek phase understands per-stream routing.
 func (c *H2AdaptorConn) Read(buf []byte) (n int, err error) {
-	<-c.h2ConnCreated
+	select {
+	case <-c.h2ConnCreated:
+	case <-c.closed:
+		return 0, net.ErrClosed
+	case <-c.dialTimedOut:
+		return 0, os.ErrDeadlineExceeded
+	}
 	return c.h2conn.Read(buf)
 }
@@ -0,0 +1,166 @@
+package http2to1
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// TestCloseBeforeDial verifies that closing an H2AdaptorConn before any
+// headers frame has triggered the upstream dial unblocks a pending Read
+// instead of hanging forever on h2ConnCreated.
+func TestCloseBeforeDial(t *testing.T) {
+	client, adaptor := net.Pipe()
+	defer client.Close()
+
+	c := NewH2AdaptorConn()
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 16)
+		_, err := c.Read(buf)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != net.ErrClosed {
+			t.Fatalf("Read after Close: got %v, want %v", err, net.ErrClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read did not return after Close-before-dial")
+	}
+
+	adaptor.Close()
+}
+
+// TestDeadlineBeforeDial verifies that a read deadline set before the dial
+// completes still unblocks a pending Read with os.ErrDeadlineExceeded.
+func TestDeadlineBeforeDial(t *testing.T) {
+	client, adaptor := net.Pipe()
+	defer client.Close()
+	defer adaptor.Close()
+
+	c := NewH2AdaptorConn()
+	if err := c.SetReadDeadline(time.Now().Add(20 * time.Millisecond)); err != nil {
+		t.Fatalf("SetReadDeadline: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 16)
+		_, err := c.Read(buf)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != os.ErrDeadlineExceeded {
+			t.Fatalf("Read after deadline: got %v, want %v", err, os.ErrDeadlineExceeded)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read did not return after deadline-before-dial")
+	}
+}
+
+// encodeTestHeadersFrame builds a single HEADERS frame (no connection
+// preface) carrying :authority/:scheme, matching what onHeadersBuf expects
+// to find in peekBuf.
+func encodeTestHeadersFrame(t *testing.T, authority, scheme string) []byte {
+	t.Helper()
+	var headerBlock bytes.Buffer
+	enc := hpack.NewEncoder(&headerBlock)
+	fields := []hpack.HeaderField{
+		{Name: ":method", Value: "GET"},
+		{Name: ":scheme", Value: scheme},
+		{Name: ":authority", Value: authority},
+		{Name: ":path", Value: "/"},
+	}
+	for _, f := range fields {
+		if err := enc.WriteField(f); err != nil {
+			t.Fatalf("WriteField: %v", err)
+		}
+	}
+
+	var frame bytes.Buffer
+	framer := http2.NewFramer(&frame, nil)
+	if err := framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: headerBlock.Bytes(),
+		EndHeaders:    true,
+	}); err != nil {
+		t.Fatalf("WriteHeaders: %v", err)
+	}
+	return frame.Bytes()
+}
+
+// TestCloseDuringDialReleasesPooledConn verifies that closing an
+// H2AdaptorConn while its upstream dial is still in flight causes the
+// eventually-dialed pooledConn to be released back to the pool instead of
+// silently adopted by a conn nobody will ever call Close on again.
+func TestCloseDuringDialReleasesPooledConn(t *testing.T) {
+	dialStarted := make(chan struct{})
+	dialBlock := make(chan struct{})
+	pool := NewClientConnPool(func(ctx context.Context, authority, scheme string, fp Fingerprint) (net.Conn, string, error) {
+		close(dialStarted)
+		<-dialBlock
+		// net.Pipe is unbuffered: drain the peer so onHeadersBuf's write of
+		// the preface and HEADERS onto the pooled conn can complete.
+		server, peer := net.Pipe()
+		go io.Copy(io.Discard, peer)
+		return server, "h2", nil
+	})
+
+	c := &H2AdaptorConn{
+		decoder:       hpack.NewDecoder(4096, nil),
+		peekBuf:       bytes.NewBuffer(nil),
+		writeBuf:      bytes.NewBuffer(nil),
+		pool:          pool,
+		h2ConnCreated: make(chan struct{}),
+		closed:        make(chan struct{}),
+		dialTimedOut:  make(chan struct{}),
+	}
+
+	writeDone := make(chan error, 1)
+	go func() {
+		_, err := c.Write(encodeTestHeadersFrame(t, "example.com", "https"))
+		writeDone <- err
+	}()
+
+	select {
+	case <-dialStarted:
+	case <-time.After(time.Second):
+		t.Fatal("dial did not start")
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	close(dialBlock)
+
+	select {
+	case err := <-writeDone:
+		if err != net.ErrClosed {
+			t.Fatalf("Write after concurrent Close: got %v, want %v", err, net.ErrClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Write did not return after dial completed post-Close")
+	}
+
+	c.mu.Lock()
+	adopted := c.pooledConn
+	c.mu.Unlock()
+	if adopted != nil {
+		t.Fatal("pooledConn was adopted by a closed H2AdaptorConn instead of being released")
+	}
+}
@@ -0,0 +1,282 @@
+package http2to1
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// maxPushFrameSize mirrors the default SETTINGS_MAX_FRAME_SIZE so DATA
+// frames we synthesize never exceed what a peer advertising defaults can
+// accept.
+const maxPushFrameSize = 16384
+
+// errPushDisabled is returned by H2PushServer.Push when the peer's
+// SETTINGS_ENABLE_PUSH is off; it satisfies prefetch's pushDisabledError
+// interface (by duck typing, not an import) so callers can tell "push is
+// off" apart from a genuine write failure.
+type errPushDisabled struct{}
+
+func (errPushDisabled) Error() string {
+	return "http2to1: push disabled by client"
+}
+
+func (errPushDisabled) PushDisabled() bool {
+	return true
+}
+
+// H2PushServer synthesizes PUSH_PROMISE + HEADERS + DATA frames on the
+// client-facing HTTP/2 connection that served a parent document, so
+// prefetched resources show up as a real server push instead of travelling
+// over the side-channel PushChannelServer.
+type H2PushServer struct {
+	framer *http2.Framer
+
+	// writeMu serializes the PUSH_PROMISE->HEADERS->DATA sequence of one
+	// Push call against another: http2.Framer requires callers not invoke
+	// its Write methods concurrently, and two Push calls racing would
+	// interleave frames (and HPACK-encoded header blocks) on the wire.
+	writeMu sync.Mutex
+
+	mu                   sync.Mutex
+	encBuf               bytes.Buffer
+	encoder              *hpack.Encoder
+	enablePush           bool
+	maxConcurrentStreams uint32
+	activePushes         uint32
+	nextPromisedStreamID uint32
+	sendWindow           int32
+}
+
+// NewH2PushServer wraps the http2.Framer already used to write frames to
+// the client on the MITM's server side.
+func NewH2PushServer(framer *http2.Framer) *H2PushServer {
+	p := &H2PushServer{
+		framer:               framer,
+		enablePush:           true,
+		maxConcurrentStreams: defaultMaxConcurrentStreams,
+		// server-initiated (pushed) streams use even IDs, per RFC 7540 §5.1.1.
+		nextPromisedStreamID: 2,
+		sendWindow:           65535,
+	}
+	p.encoder = hpack.NewEncoder(&p.encBuf)
+	return p
+}
+
+// OnPeerSettings updates enablePush/maxConcurrentStreams/initial window
+// from the client's SETTINGS frame; call it from the frame loop that reads
+// the client-facing connection.
+func (p *H2PushServer) OnPeerSettings(settings []http2.Setting) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, s := range settings {
+		switch s.ID {
+		case http2.SettingEnablePush:
+			p.enablePush = s.Val != 0
+		case http2.SettingMaxConcurrentStreams:
+			p.maxConcurrentStreams = s.Val
+		case http2.SettingInitialWindowSize:
+			p.sendWindow = int32(s.Val)
+		}
+	}
+}
+
+// OnWindowUpdate credits the connection-level send window from a
+// WINDOW_UPDATE frame the client sent us.
+func (p *H2PushServer) OnWindowUpdate(increment uint32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sendWindow += int32(increment)
+}
+
+func (p *H2PushServer) reserveStream() (uint32, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.enablePush {
+		return 0, errPushDisabled{}
+	}
+	if p.activePushes >= p.maxConcurrentStreams {
+		return 0, fmt.Errorf("http2to1: push stream limit (%d) reached", p.maxConcurrentStreams)
+	}
+	streamID := p.nextPromisedStreamID
+	p.nextPromisedStreamID += 2
+	p.activePushes++
+	return streamID, nil
+}
+
+func (p *H2PushServer) releaseStream() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.activePushes > 0 {
+		p.activePushes--
+	}
+}
+
+// takeSendWindow reserves up to want bytes of connection send window,
+// returning however much was actually available.
+func (p *H2PushServer) takeSendWindow(want int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sendWindow <= 0 {
+		return 0
+	}
+	n := want
+	if int32(n) > p.sendWindow {
+		n = int(p.sendWindow)
+	}
+	p.sendWindow -= int32(n)
+	return n
+}
+
+func (p *H2PushServer) encodeHeaders(pairs []hpack.HeaderField) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.encBuf.Reset()
+	for _, hf := range pairs {
+		if err := p.encoder.WriteField(hf); err != nil {
+			return nil, err
+		}
+	}
+	return append([]byte(nil), p.encBuf.Bytes()...), nil
+}
+
+// Push synthesizes the PUSH_PROMISE on parentStreamID followed by the
+// pushed stream's HEADERS and DATA frames. It implements
+// prefetch.H2Pusher.
+func (p *H2PushServer) Push(ctx context.Context, parentStreamID uint32, req *http.Request, resp *http.Response) error {
+	streamID, err := p.reserveStream()
+	if err != nil {
+		return err
+	}
+	defer p.releaseStream()
+
+	// Hold writeMu across the whole PUSH_PROMISE->HEADERS->DATA sequence so
+	// a concurrent Push for another resource can't interleave its frames
+	// (or HPACK state) with this one on the client-facing connection.
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+
+	promiseBlock, err := p.encodeHeaders(requestPseudoHeaders(req))
+	if err != nil {
+		return fmt.Errorf("encode promised request headers: %w", err)
+	}
+	if err := p.framer.WritePushPromise(http2.PushPromiseParam{
+		StreamID:      parentStreamID,
+		PromiseID:     streamID,
+		BlockFragment: promiseBlock,
+		EndHeaders:    true,
+	}); err != nil {
+		return fmt.Errorf("write PUSH_PROMISE: %w", err)
+	}
+
+	if err := p.pushBody(streamID, resp); err != nil {
+		// The client already has a PUSH_PROMISE for streamID; abandoning it
+		// here without a terminating frame would leave a half-open pushed
+		// stream on the client-facing connection forever. Reset it instead.
+		if rstErr := p.framer.WriteRSTStream(streamID, http2.ErrCodeInternal); rstErr != nil {
+			log.Println("== failed to reset abandoned pushed stream", streamID, ":", rstErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// pushBody writes the pushed stream's HEADERS followed by its DATA, once
+// Push has already committed to the promise with a PUSH_PROMISE frame.
+func (p *H2PushServer) pushBody(streamID uint32, resp *http.Response) error {
+	headersBlock, err := p.encodeHeaders(responseHeaders(resp))
+	if err != nil {
+		return fmt.Errorf("encode pushed response headers: %w", err)
+	}
+	if err := p.framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      streamID,
+		BlockFragment: headersBlock,
+		EndHeaders:    true,
+	}); err != nil {
+		return fmt.Errorf("write pushed HEADERS: %w", err)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read pushed body: %w", err)
+	}
+	return p.writeData(streamID, body)
+}
+
+func (p *H2PushServer) writeData(streamID uint32, body []byte) error {
+	if len(body) == 0 {
+		return p.framer.WriteData(streamID, true, nil)
+	}
+	for len(body) > 0 {
+		chunkSize := len(body)
+		if chunkSize > maxPushFrameSize {
+			chunkSize = maxPushFrameSize
+		}
+		if n := p.takeSendWindow(chunkSize); n < chunkSize {
+			if n == 0 {
+				return fmt.Errorf("http2to1: pushed stream %d has no send window left", streamID)
+			}
+			chunkSize = n
+		}
+		endStream := chunkSize == len(body)
+		if err := p.framer.WriteData(streamID, endStream, body[:chunkSize]); err != nil {
+			return err
+		}
+		body = body[chunkSize:]
+	}
+	return nil
+}
+
+func requestPseudoHeaders(req *http.Request) []hpack.HeaderField {
+	scheme := req.URL.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	headers := []hpack.HeaderField{
+		{Name: ":method", Value: req.Method},
+		{Name: ":scheme", Value: scheme},
+		{Name: ":authority", Value: req.URL.Host},
+		{Name: ":path", Value: req.URL.RequestURI()},
+	}
+	for k, vs := range req.Header {
+		for _, v := range vs {
+			headers = append(headers, hpack.HeaderField{Name: toLowerHeaderName(k), Value: v})
+		}
+	}
+	return headers
+}
+
+func responseHeaders(resp *http.Response) []hpack.HeaderField {
+	headers := []hpack.HeaderField{
+		{Name: ":status", Value: strconv.Itoa(resp.StatusCode)},
+	}
+	for k, vs := range resp.Header {
+		for _, v := range vs {
+			headers = append(headers, hpack.HeaderField{Name: toLowerHeaderName(k), Value: v})
+		}
+	}
+	return headers
+}
+
+// toLowerHeaderName lower-cases an http.Header key back to wire form; Go's
+// http.Header canonicalizes to e.g. "Content-Type" but HTTP/2 requires
+// lowercase field names.
+func toLowerHeaderName(name string) string {
+	buf := make([]byte, len(name))
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		buf[i] = c
+	}
+	return string(buf)
+}
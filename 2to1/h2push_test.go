@@ -0,0 +1,167 @@
+package http2to1
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+func newTestResponse(body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/plain"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func newTestRequest(t *testing.T) *http.Request {
+	t.Helper()
+	u, err := url.Parse("https://example.com/style.css")
+	if err != nil {
+		t.Fatalf("url.Parse: %v", err)
+	}
+	return &http.Request{Method: "GET", URL: u, Header: http.Header{}}
+}
+
+// readFrames decodes every frame buf contains, in order.
+func readFrames(t *testing.T, buf []byte) []http2.Frame {
+	t.Helper()
+	framer := http2.NewFramer(nil, bytes.NewReader(buf))
+	var frames []http2.Frame
+	for {
+		f, err := framer.ReadFrame()
+		if err != nil {
+			return frames
+		}
+		frames = append(frames, f)
+	}
+}
+
+func TestPushWritesPromiseHeadersAndData(t *testing.T) {
+	var out bytes.Buffer
+	p := NewH2PushServer(http2.NewFramer(&out, nil))
+
+	if err := p.Push(context.Background(), 1, newTestRequest(t), newTestResponse("body")); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+
+	frames := readFrames(t, out.Bytes())
+	if len(frames) != 3 {
+		t.Fatalf("got %d frames, want 3 (PUSH_PROMISE, HEADERS, DATA): %+v", len(frames), frames)
+	}
+	if _, ok := frames[0].(*http2.PushPromiseFrame); !ok {
+		t.Fatalf("frame[0] = %T, want *http2.PushPromiseFrame", frames[0])
+	}
+	if _, ok := frames[1].(*http2.HeadersFrame); !ok {
+		t.Fatalf("frame[1] = %T, want *http2.HeadersFrame", frames[1])
+	}
+	data, ok := frames[2].(*http2.DataFrame)
+	if !ok {
+		t.Fatalf("frame[2] = %T, want *http2.DataFrame", frames[2])
+	}
+	if string(data.Data()) != "body" {
+		t.Fatalf("pushed data = %q, want %q", data.Data(), "body")
+	}
+	if !data.StreamEnded() {
+		t.Fatal("final DATA frame did not end the stream")
+	}
+}
+
+func TestPushDisabledByClientSettings(t *testing.T) {
+	var out bytes.Buffer
+	p := NewH2PushServer(http2.NewFramer(&out, nil))
+	p.OnPeerSettings([]http2.Setting{{ID: http2.SettingEnablePush, Val: 0}})
+
+	err := p.Push(context.Background(), 1, newTestRequest(t), newTestResponse("body"))
+	if !isPushDisabledErr(err) {
+		t.Fatalf("Push after push disabled: got %v, want a pushDisabledError", err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("Push wrote %d bytes after push was disabled, want 0", out.Len())
+	}
+}
+
+func isPushDisabledErr(err error) bool {
+	pd, ok := err.(interface{ PushDisabled() bool })
+	return ok && pd.PushDisabled()
+}
+
+// TestPushResetsStreamOnSendWindowExhaustion verifies that when the send
+// window is too small to carry the pushed body, Push resets the stream it
+// already promised instead of leaving it half-open forever.
+func TestPushResetsStreamOnSendWindowExhaustion(t *testing.T) {
+	var out bytes.Buffer
+	p := NewH2PushServer(http2.NewFramer(&out, nil))
+	p.mu.Lock()
+	p.sendWindow = 0
+	p.mu.Unlock()
+
+	err := p.Push(context.Background(), 1, newTestRequest(t), newTestResponse("body"))
+	if err == nil {
+		t.Fatal("Push succeeded despite zero send window")
+	}
+
+	frames := readFrames(t, out.Bytes())
+	if len(frames) != 3 {
+		t.Fatalf("got %d frames, want 3 (PUSH_PROMISE, HEADERS, RST_STREAM): %+v", len(frames), frames)
+	}
+	if _, ok := frames[0].(*http2.PushPromiseFrame); !ok {
+		t.Fatalf("frame[0] = %T, want *http2.PushPromiseFrame", frames[0])
+	}
+	if _, ok := frames[1].(*http2.HeadersFrame); !ok {
+		t.Fatalf("frame[1] = %T, want *http2.HeadersFrame", frames[1])
+	}
+	rst, ok := frames[2].(*http2.RSTStreamFrame)
+	if !ok {
+		t.Fatalf("frame[2] = %T, want *http2.RSTStreamFrame", frames[2])
+	}
+	if rst.StreamID != 2 {
+		t.Fatalf("RST_STREAM StreamID = %d, want 2 (first promised stream ID)", rst.StreamID)
+	}
+}
+
+func TestTakeSendWindowCapsAtAvailable(t *testing.T) {
+	var out bytes.Buffer
+	p := NewH2PushServer(http2.NewFramer(&out, nil))
+	p.mu.Lock()
+	p.sendWindow = 10
+	p.mu.Unlock()
+
+	if n := p.takeSendWindow(100); n != 10 {
+		t.Fatalf("takeSendWindow(100) with window=10: got %d, want 10", n)
+	}
+	if n := p.takeSendWindow(1); n != 0 {
+		t.Fatalf("takeSendWindow(1) after window exhausted: got %d, want 0", n)
+	}
+
+	p.OnWindowUpdate(5)
+	if n := p.takeSendWindow(100); n != 5 {
+		t.Fatalf("takeSendWindow(100) after WINDOW_UPDATE(5): got %d, want 5", n)
+	}
+}
+
+func TestReserveStreamRejectsAtConcurrencyLimit(t *testing.T) {
+	var out bytes.Buffer
+	p := NewH2PushServer(http2.NewFramer(&out, nil))
+	p.mu.Lock()
+	p.maxConcurrentStreams = 1
+	p.mu.Unlock()
+
+	if _, err := p.reserveStream(); err != nil {
+		t.Fatalf("reserveStream (1st): %v", err)
+	}
+	if _, err := p.reserveStream(); err == nil {
+		t.Fatal("reserveStream (2nd) succeeded despite maxConcurrentStreams=1")
+	}
+
+	p.releaseStream()
+	if _, err := p.reserveStream(); err != nil {
+		t.Fatalf("reserveStream after release: %v", err)
+	}
+}
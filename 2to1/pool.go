@@ -0,0 +1,303 @@
+package http2to1
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+const (
+	// defaultMaxConcurrentStreams is assumed for a pooled conn until the
+	// peer's own SETTINGS_MAX_CONCURRENT_STREAMS has been observed. It's
+	// tracked for visibility and for when maxConcurrentOwnersUntilDemux
+	// below goes away, but it does not yet gate acquisition.
+	defaultMaxConcurrentStreams = 100
+	// maxConcurrentOwnersUntilDemux caps how many H2AdaptorConns may check
+	// out the same pooledConn at once. onHeadersBuf still writes each
+	// adaptor's raw HTTP/2 bytes (including its own connection preface)
+	// straight onto the shared conn, and Read isn't demultiplexed by stream
+	// ID, so letting two adaptors share a conn concurrently corrupts the
+	// upstream session. Pooling still gives its main benefit - reusing an
+	// idle conn instead of dialing fresh - it just can't multiplex streams
+	// within one conn yet. Raise this once onHeadersBuf/Read route frames
+	// per client stream.
+	maxConcurrentOwnersUntilDemux = 1
+	// defaultIdleTimeout is how long a pooled conn with zero active streams
+	// is kept around before being closed and evicted.
+	defaultIdleTimeout = 90 * time.Second
+	// defaultMaxConnsPerAuthority caps how many upstream conns a single
+	// authority+scheme may hold in the pool at once.
+	defaultMaxConnsPerAuthority = 8
+)
+
+// poolKey identifies a family of pooled upstream conns. ALPN is included
+// because a conn negotiated as "http/1.1" can't serve an h2 stream and vice
+// versa, even though both share the same authority and scheme. fingerprint
+// is included so a conn dialed with one browser's ClientHello is never
+// handed to a client impersonating a different one.
+type poolKey struct {
+	authority   string
+	scheme      string
+	alpn        string
+	fingerprint Fingerprint
+}
+
+// pooledConn wraps a live upstream conn together with the bookkeeping the
+// pool needs to hand it out, take it back and evict it.
+type pooledConn struct {
+	net.Conn
+	key poolKey
+
+	mu            sync.Mutex
+	maxStreams    uint32
+	activeStreams uint32
+	closed        bool
+	idleSince     time.Time
+	// primed is set once this conn has carried one client's connection
+	// preface and stream-ID-1 HEADERS (see markPrimed). A primed conn can't
+	// safely be handed to a second client: onHeadersBuf always resends the
+	// preface and restarts stream IDs at 1, which is only valid once per
+	// conn until the pool can demux/renumber streams onto an
+	// already-established upstream session. tryAcquire excludes primed
+	// conns so GetOrDial's "reuse" path never actually reuses a live one;
+	// this effectively disables reuse until that demuxing lands, rather
+	// than claiming to reuse a conn it would corrupt.
+	primed bool
+}
+
+func newPooledConn(conn net.Conn, key poolKey) *pooledConn {
+	return &pooledConn{
+		Conn:       conn,
+		key:        key,
+		maxStreams: defaultMaxConcurrentStreams,
+		idleSince:  time.Now(),
+	}
+}
+
+// tryAcquire reserves stream capacity, returning false if the conn is full
+// or has already been evicted. Capacity is capped at
+// maxConcurrentOwnersUntilDemux regardless of pc.maxStreams until frame
+// demuxing exists; see the comment on that constant.
+func (pc *pooledConn) tryAcquire() bool {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.closed || pc.primed || pc.activeStreams >= maxConcurrentOwnersUntilDemux {
+		return false
+	}
+	pc.activeStreams++
+	return true
+}
+
+// markPrimed records that this conn has now carried a preface and
+// stream-ID-1 HEADERS, so tryAcquire stops handing it out. Call once the
+// first client's frames have actually been forwarded onto it.
+func (pc *pooledConn) markPrimed() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.primed = true
+}
+
+func (pc *pooledConn) release() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.activeStreams > 0 {
+		pc.activeStreams--
+	}
+	if pc.activeStreams == 0 {
+		pc.idleSince = time.Now()
+	}
+}
+
+func (pc *pooledConn) setMaxStreams(n uint32) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.maxStreams = n
+}
+
+func (pc *pooledConn) evict(reason error) {
+	pc.mu.Lock()
+	if pc.closed {
+		pc.mu.Unlock()
+		return
+	}
+	pc.closed = true
+	pc.mu.Unlock()
+	log.Println("== evicting pooled conn:", pc.key, "reason:", reason)
+	pc.Conn.Close()
+}
+
+func (pc *pooledConn) isIdleSince(cutoff time.Time) bool {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.activeStreams == 0 && pc.idleSince.Before(cutoff)
+}
+
+func (pc *pooledConn) isClosed() bool {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.closed
+}
+
+// Read sniffs frames coming back from upstream so the pool can track the
+// peer's advertised stream capacity and evict on GOAWAY/RST_STREAM without
+// requiring every caller to parse frames themselves.
+func (pc *pooledConn) Read(buf []byte) (int, error) {
+	n, err := pc.Conn.Read(buf)
+	if n > 0 {
+		pc.sniffFrames(buf[:n])
+	}
+	if err != nil && err != io.EOF {
+		pc.evict(err)
+	}
+	return n, err
+}
+
+func (pc *pooledConn) Write(buf []byte) (int, error) {
+	n, err := pc.Conn.Write(buf)
+	if err != nil {
+		pc.evict(err)
+	}
+	return n, err
+}
+
+// sniffFrames best-effort parses complete frames out of buf and reacts to
+// the ones that affect pool bookkeeping. Frames that straddle reads are not
+// reassembled: a frame cut off at the end of buf is skipped and never
+// observed, so we only act on frame types that are small enough to usually
+// land in one Read.
+func (pc *pooledConn) sniffFrames(buf []byte) {
+	framer := http2.NewFramer(nil, bytes.NewReader(buf))
+	framer.ReadMetaHeaders = nil
+	for {
+		f, err := framer.ReadFrame()
+		if err != nil {
+			return
+		}
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if n, ok := f.Value(http2.SettingMaxConcurrentStreams); ok {
+				pc.setMaxStreams(n)
+			}
+		case *http2.GoAwayFrame:
+			pc.evict(fmt.Errorf("received GOAWAY: %s", f.ErrCode))
+		case *http2.RSTStreamFrame:
+			pc.evict(fmt.Errorf("received RST_STREAM: %s", f.ErrCode))
+		}
+	}
+}
+
+// ClientConnPool keeps live upstream conns keyed by authority, scheme, ALPN
+// and fingerprint, in the role of golang.org/x/net/http2's clientConnPool.
+// A conn is checked out by one H2AdaptorConn at a time, and a conn that has
+// carried a client's preface (primed) is not handed out again, so client
+// streams do not multiplex over a shared connection; only a conn released
+// before it was primed is reused.
+type ClientConnPool struct {
+	dial func(ctx context.Context, authority, scheme string, fp Fingerprint) (net.Conn, string, error)
+
+	mu    sync.Mutex
+	conns map[poolKey][]*pooledConn
+}
+
+func NewClientConnPool(dial func(ctx context.Context, authority, scheme string, fp Fingerprint) (net.Conn, string, error)) *ClientConnPool {
+	p := &ClientConnPool{
+		dial:  dial,
+		conns: make(map[poolKey][]*pooledConn),
+	}
+	go p.evictIdleLoop()
+	return p
+}
+
+// GetOrDial returns a pooled conn with spare stream capacity for the given
+// authority+scheme+fingerprint, reusing an existing one when possible and
+// only dialing fresh on a miss (no idle conn, or every conn is at capacity
+// / evicted). ctx bounds the dial itself, so a deadline set on the caller
+// before the dial started actually unblocks it instead of only unblocking
+// callers waiting on the result.
+func (p *ClientConnPool) GetOrDial(ctx context.Context, authority, scheme string, fp Fingerprint) (*pooledConn, error) {
+	if pc := p.acquireExisting(authority, scheme, fp); pc != nil {
+		return pc, nil
+	}
+
+	p.mu.Lock()
+	n := 0
+	for key, conns := range p.conns {
+		if key.authority == authority && key.scheme == scheme {
+			n += len(conns)
+		}
+	}
+	if n >= defaultMaxConnsPerAuthority {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("http2to1: pool exhausted for %s (%d conns)", authority, n)
+	}
+	p.mu.Unlock()
+
+	conn, alpn, err := p.dial(ctx, authority, scheme, fp)
+	if err != nil {
+		return nil, err
+	}
+	key := poolKey{authority: authority, scheme: scheme, alpn: alpn, fingerprint: fp}
+	pc := newPooledConn(conn, key)
+	pc.tryAcquire()
+
+	p.mu.Lock()
+	p.conns[key] = append(p.conns[key], pc)
+	p.mu.Unlock()
+	return pc, nil
+}
+
+func (p *ClientConnPool) acquireExisting(authority, scheme string, fp Fingerprint) *pooledConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, conns := range p.conns {
+		if key.authority != authority || key.scheme != scheme || key.fingerprint != fp {
+			continue
+		}
+		for _, pc := range conns {
+			if pc.tryAcquire() {
+				return pc
+			}
+		}
+	}
+	return nil
+}
+
+// Release gives back the stream capacity a successful GetOrDial reserved.
+func (p *ClientConnPool) Release(pc *pooledConn) {
+	pc.release()
+}
+
+func (p *ClientConnPool) evictIdleLoop() {
+	ticker := time.NewTicker(defaultIdleTimeout / 3)
+	defer ticker.Stop()
+	for range ticker.C {
+		cutoff := time.Now().Add(-defaultIdleTimeout)
+		p.mu.Lock()
+		for key, conns := range p.conns {
+			live := conns[:0]
+			for _, pc := range conns {
+				if pc.isClosed() {
+					continue
+				}
+				if pc.isIdleSince(cutoff) {
+					pc.evict(fmt.Errorf("idle timeout"))
+					continue
+				}
+				live = append(live, pc)
+			}
+			if len(live) == 0 {
+				delete(p.conns, key)
+			} else {
+				p.conns[key] = live
+			}
+		}
+		p.mu.Unlock()
+	}
+}
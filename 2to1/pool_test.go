@@ -0,0 +1,148 @@
+package http2to1
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestPooledConn(t *testing.T) (*pooledConn, net.Conn) {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	pc := newPooledConn(server, poolKey{authority: "example.com", scheme: "https", alpn: "h2"})
+	return pc, client
+}
+
+func TestTryAcquireRespectsCapacityAndPrimed(t *testing.T) {
+	pc, _ := newTestPooledConn(t)
+
+	if !pc.tryAcquire() {
+		t.Fatal("tryAcquire (1st) failed on a fresh conn")
+	}
+	if pc.tryAcquire() {
+		t.Fatal("tryAcquire (2nd) succeeded past maxConcurrentOwnersUntilDemux")
+	}
+
+	pc.release()
+	if pc.activeStreams != 0 {
+		t.Fatalf("activeStreams after release = %d, want 0", pc.activeStreams)
+	}
+
+	pc.markPrimed()
+	if pc.tryAcquire() {
+		t.Fatal("tryAcquire succeeded on a primed conn; primed conns must not be reused")
+	}
+}
+
+func TestTryAcquireRejectsClosedConn(t *testing.T) {
+	pc, _ := newTestPooledConn(t)
+	pc.evict(nil)
+	if pc.tryAcquire() {
+		t.Fatal("tryAcquire succeeded on an evicted conn")
+	}
+}
+
+func TestIsIdleSince(t *testing.T) {
+	pc, _ := newTestPooledConn(t)
+	pc.tryAcquire()
+
+	if pc.isIdleSince(time.Now().Add(time.Hour)) {
+		t.Fatal("conn with an active stream reported idle")
+	}
+
+	pc.release()
+	past := time.Now().Add(-time.Minute)
+	if pc.isIdleSince(past) {
+		t.Fatal("conn released just now reported idle since a minute ago")
+	}
+	future := time.Now().Add(time.Minute)
+	if !pc.isIdleSince(future) {
+		t.Fatal("idle conn not reported idle since a future cutoff")
+	}
+}
+
+func TestGetOrDialReusesFreshConnThenStopsOncePrimed(t *testing.T) {
+	var dials int
+	dial := func(ctx context.Context, authority, scheme string, fp Fingerprint) (net.Conn, string, error) {
+		dials++
+		server, _ := net.Pipe()
+		return server, "h2", nil
+	}
+	pool := NewClientConnPool(dial)
+
+	pc1, err := pool.GetOrDial(context.Background(), "example.com", "https", FingerprintChrome)
+	if err != nil {
+		t.Fatalf("GetOrDial (1st): %v", err)
+	}
+	if dials != 1 {
+		t.Fatalf("dials after 1st GetOrDial = %d, want 1", dials)
+	}
+
+	// Released but not yet primed: a second caller may still reuse it.
+	pool.Release(pc1)
+	pc2, err := pool.GetOrDial(context.Background(), "example.com", "https", FingerprintChrome)
+	if err != nil {
+		t.Fatalf("GetOrDial (2nd, before primed): %v", err)
+	}
+	if pc2 != pc1 {
+		t.Fatal("GetOrDial dialed fresh instead of reusing an unprimed idle conn")
+	}
+	if dials != 1 {
+		t.Fatalf("dials after reusing unprimed conn = %d, want 1", dials)
+	}
+
+	pc2.markPrimed()
+	pool.Release(pc2)
+
+	pc3, err := pool.GetOrDial(context.Background(), "example.com", "https", FingerprintChrome)
+	if err != nil {
+		t.Fatalf("GetOrDial (3rd, after primed): %v", err)
+	}
+	if pc3 == pc2 {
+		t.Fatal("GetOrDial handed out an already-primed conn")
+	}
+	if dials != 2 {
+		t.Fatalf("dials after primed conn excluded = %d, want 2", dials)
+	}
+}
+
+func TestGetOrDialRejectsMismatchedFingerprint(t *testing.T) {
+	dial := func(ctx context.Context, authority, scheme string, fp Fingerprint) (net.Conn, string, error) {
+		server, _ := net.Pipe()
+		return server, "h2", nil
+	}
+	pool := NewClientConnPool(dial)
+
+	pcChrome, err := pool.GetOrDial(context.Background(), "example.com", "https", FingerprintChrome)
+	if err != nil {
+		t.Fatalf("GetOrDial (chrome): %v", err)
+	}
+	pool.Release(pcChrome)
+
+	pcFirefox, err := pool.GetOrDial(context.Background(), "example.com", "https", FingerprintFirefox)
+	if err != nil {
+		t.Fatalf("GetOrDial (firefox): %v", err)
+	}
+	if pcFirefox == pcChrome {
+		t.Fatal("GetOrDial handed a Chrome-fingerprinted conn to a Firefox-fingerprinted request")
+	}
+}
+
+func TestGetOrDialExhaustsPoolPerAuthority(t *testing.T) {
+	dial := func(ctx context.Context, authority, scheme string, fp Fingerprint) (net.Conn, string, error) {
+		server, _ := net.Pipe()
+		return server, "h2", nil
+	}
+	pool := NewClientConnPool(dial)
+
+	for i := 0; i < defaultMaxConnsPerAuthority; i++ {
+		if _, err := pool.GetOrDial(context.Background(), "example.com", "https", FingerprintChrome); err != nil {
+			t.Fatalf("GetOrDial (%d): %v", i, err)
+		}
+	}
+	if _, err := pool.GetOrDial(context.Background(), "example.com", "https", FingerprintChrome); err == nil {
+		t.Fatal("GetOrDial succeeded past defaultMaxConnsPerAuthority")
+	}
+}
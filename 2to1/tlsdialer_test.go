@@ -0,0 +1,64 @@
+package http2to1
+
+import "testing"
+
+func TestFingerprintFromJA3(t *testing.T) {
+	cases := []struct {
+		name string
+		ja3  string
+		want Fingerprint
+	}{
+		{
+			name: "chrome ja3 has GREASE extensions",
+			// version,ciphers,extensions,curves,curve_point_formats
+			ja3:  "771,4865-4866-4867,2570-0-23-35-16-51914-21,29-23-24,0",
+			want: FingerprintChrome,
+		},
+		{
+			name: "firefox ja3 has no GREASE extensions",
+			ja3:  "771,4865-4866-4867,0-23-65281-10-11-35-16-5-51-43-13-45-28-21,29-23-24-25-256-257,0",
+			want: FingerprintFirefox,
+		},
+		{
+			name: "empty ja3 defaults to chrome",
+			ja3:  "",
+			want: FingerprintChrome,
+		},
+		{
+			name: "malformed ja3 missing fields defaults to chrome",
+			ja3:  "771,4865-4866",
+			want: FingerprintChrome,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := FingerprintFromJA3(tc.ja3); got != tc.want {
+				t.Errorf("FingerprintFromJA3(%q) = %v, want %v", tc.ja3, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIsGREASEExtension(t *testing.T) {
+	greaseIDs := []int{2570, 6682, 10794, 14906, 19018, 23130, 27242, 31354}
+	for _, id := range greaseIDs {
+		if !isGREASEExtension(id) {
+			t.Errorf("isGREASEExtension(%d) = false, want true", id)
+		}
+	}
+	nonGREASEIDs := []int{0, 23, 35, 16, -1, 0x10000}
+	for _, id := range nonGREASEIDs {
+		if isGREASEExtension(id) {
+			t.Errorf("isGREASEExtension(%d) = true, want false", id)
+		}
+	}
+}
+
+func TestDialerForFingerprintFallsBackToChrome(t *testing.T) {
+	if dialerForFingerprint(FingerprintChrome) != tlsDialers[FingerprintChrome] {
+		t.Fatal("dialerForFingerprint(FingerprintChrome) did not return the Chrome dialer")
+	}
+	if dialerForFingerprint(Fingerprint(99)) != tlsDialers[FingerprintChrome] {
+		t.Fatal("dialerForFingerprint(unknown) did not fall back to the Chrome dialer")
+	}
+}
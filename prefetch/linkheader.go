@@ -0,0 +1,76 @@
+package prefetch
+
+import "strings"
+
+// linkHeaderEntry is one comma-separated entry of an RFC 8288 Link header,
+// e.g. `<https://example.com/app.js>; rel="preload"; as="script"`.
+type linkHeaderEntry struct {
+	target string
+	rel    string
+}
+
+// splitLinkHeaderEntries splits a Link header value on its top-level commas,
+// i.e. commas that aren't inside the `<...>` target or a quoted param value.
+func splitLinkHeaderEntries(header string) []string {
+	var entries []string
+	depth := 0
+	inQuotes := false
+	start := 0
+	for i, r := range header {
+		switch r {
+		case '<':
+			if !inQuotes {
+				depth++
+			}
+		case '>':
+			if !inQuotes && depth > 0 {
+				depth--
+			}
+		case '"':
+			inQuotes = !inQuotes
+		case ',':
+			if depth == 0 && !inQuotes {
+				entries = append(entries, header[start:i])
+				start = i + 1
+			}
+		}
+	}
+	entries = append(entries, header[start:])
+	return entries
+}
+
+// parseLinkHeader parses a single Link header value into its entries,
+// lower-casing `rel` so callers can match it directly.
+func parseLinkHeader(header string) []linkHeaderEntry {
+	var out []linkHeaderEntry
+	for _, raw := range splitLinkHeaderEntries(header) {
+		parts := strings.Split(raw, ";")
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		target = strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">")
+
+		entry := linkHeaderEntry{target: target}
+		for _, param := range parts[1:] {
+			k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(k), "rel") {
+				continue
+			}
+			entry.rel = strings.ToLower(strings.Trim(strings.TrimSpace(v), `"`))
+		}
+		if entry.target != "" && entry.rel != "" {
+			out = append(out, entry)
+		}
+	}
+	return out
+}
+
+func isPrefetchableLinkRel(rel string) bool {
+	switch rel {
+	case "preload", "prefetch", "modulepreload":
+		return true
+	default:
+		return false
+	}
+}
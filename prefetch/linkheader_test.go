@@ -0,0 +1,61 @@
+package prefetch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitLinkHeaderEntriesRespectsQuotesAndAngleBrackets(t *testing.T) {
+	header := `<https://example.com/a.js>; rel="preload"; title="a, b, c", <https://example.com/b.css>; rel="preload"`
+	got := splitLinkHeaderEntries(header)
+	want := []string{
+		`<https://example.com/a.js>; rel="preload"; title="a, b, c"`,
+		` <https://example.com/b.css>; rel="preload"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("splitLinkHeaderEntries() = %#v, want %#v", got, want)
+	}
+}
+
+func TestParseLinkHeaderSkipsEntryMissingRel(t *testing.T) {
+	header := `<https://example.com/a.js>; as="script", <https://example.com/b.js>; rel="preload"`
+	entries := parseLinkHeader(header)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1 (entry without rel dropped): %+v", len(entries), entries)
+	}
+	if entries[0].target != "https://example.com/b.js" || entries[0].rel != "preload" {
+		t.Fatalf("unexpected entry: %+v", entries[0])
+	}
+}
+
+func TestParseLinkHeaderAllowsRelativeTarget(t *testing.T) {
+	entries := parseLinkHeader(`</static/app.css>; rel="preload"; as="style"`)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	if entries[0].target != "/static/app.css" {
+		t.Fatalf("target = %q, want %q", entries[0].target, "/static/app.css")
+	}
+}
+
+func TestParseLinkHeaderLowercasesRel(t *testing.T) {
+	entries := parseLinkHeader(`<https://example.com/a.js>; rel="PreLoad"`)
+	if len(entries) != 1 || entries[0].rel != "preload" {
+		t.Fatalf("got %+v, want rel normalized to lowercase \"preload\"", entries)
+	}
+}
+
+func TestIsPrefetchableLinkRel(t *testing.T) {
+	cases := map[string]bool{
+		"preload":       true,
+		"prefetch":      true,
+		"modulepreload": true,
+		"stylesheet":    false,
+		"":              false,
+	}
+	for rel, want := range cases {
+		if got := isPrefetchableLinkRel(rel); got != want {
+			t.Errorf("isPrefetchableLinkRel(%q) = %v, want %v", rel, got, want)
+		}
+	}
+}
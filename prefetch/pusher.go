@@ -0,0 +1,43 @@
+package prefetch
+
+import (
+	"context"
+	"net/http"
+)
+
+// H2Pusher lets PrefetchServer deliver a prefetched resource as a real
+// HTTP/2 PUSH_PROMISE on the client-facing connection that served the
+// parent document, instead of shipping it over the bespoke push channel.
+type H2Pusher interface {
+	// Push synthesizes PUSH_PROMISE + HEADERS + DATA frames for resp on the
+	// connection that owns parentStreamID.
+	Push(ctx context.Context, parentStreamID uint32, req *http.Request, resp *http.Response) error
+}
+
+// pushDisabledError is implemented by H2Pusher errors that mean "this
+// client has HTTP/2 push turned off (or isn't h2 at all)", as opposed to a
+// genuine failure to write the push frames. prefetchResource treats the
+// former as a cue to fall back to the push channel.
+type pushDisabledError interface {
+	error
+	PushDisabled() bool
+}
+
+func isPushDisabled(err error) bool {
+	pd, ok := err.(pushDisabledError)
+	return ok && pd.PushDisabled()
+}
+
+type parentStreamIDKey struct{}
+
+// WithParentStreamID attaches the client-facing HTTP/2 stream ID that
+// carried the parent document response to ctx, so a later prefetchResource
+// call knows which stream to PUSH_PROMISE against.
+func WithParentStreamID(ctx context.Context, streamID uint32) context.Context {
+	return context.WithValue(ctx, parentStreamIDKey{}, streamID)
+}
+
+func parentStreamIDFromContext(ctx context.Context) (uint32, bool) {
+	id, ok := ctx.Value(parentStreamIDKey{}).(uint32)
+	return id, ok
+}
@@ -41,6 +41,9 @@ type PrefetchServer struct {
 	ttlHistory *common.TTLCache
 	// only one push channel is allowed for now
 	channel *PushChannelServer
+	// pusher delivers prefetched resources via real PUSH_PROMISE frames;
+	// falls back to channel when nil or when the client has push disabled.
+	pusher H2Pusher
 
 	rfc7234HttpCache httpcache.Cache
 	httpClient       common.HTTPRequestDoer
@@ -73,6 +76,12 @@ func (ps *PrefetchServer) CreatePushChannel(conn net.Conn) {
 	ps.channel = NewPushChannelServer(conn)
 }
 
+// SetH2Pusher wires up the real PUSH_PROMISE path. Call it once the
+// client-facing HTTP/2 connection for the parent document is known.
+func (ps *PrefetchServer) SetH2Pusher(pusher H2Pusher) {
+	ps.pusher = pusher
+}
+
 func filterPrefetchableDocumentResponse(resp *http.Response) bool {
 	return resp.StatusCode == http.StatusOK &&
 		resp.Request.Method == http.MethodGet &&
@@ -137,6 +146,42 @@ func (ps *PrefetchServer) TryPrefetch(ctx context.Context, resp *http.Response)
 	return nil
 }
 
+// TryPrefetchFromLinkHeaders treats RFC 8288 `Link` headers as a prefetch
+// trigger alongside TryPrefetch's HTML-head parsing. It fires on 103 Early
+// Hints responses and on any 2xx response, since servers may advertise
+// preload hints before (or instead of) buffering the document body. Only
+// entries with rel preload, prefetch or modulepreload are fetched; other
+// rels, such as preconnect, are skipped.
+func (ps *PrefetchServer) TryPrefetchFromLinkHeaders(ctx context.Context, resp *http.Response) (err error) {
+	if resp.StatusCode != http.StatusEarlyHints && resp.StatusCode/100 != 2 {
+		return nil
+	}
+	linkHeaders := resp.Header.Values("Link")
+	if len(linkHeaders) == 0 {
+		return nil
+	}
+	ctx, span := tracing.GetTracer(ctx, "prefetch").Start(ctx, "TryPrefetchFromLinkHeaders")
+	defer span.End()
+
+	docUrl := resp.Request.URL.String()
+	span.SetAttributes(attribute.String("url", docUrl))
+	ttlKey := "link:" + docUrl
+	if _, ok := ps.ttlHistory.Get(ttlKey); ok {
+		return ErrThrottled
+	}
+	ps.ttlHistory.Set(ttlKey, struct{}{})
+
+	for _, header := range linkHeaders {
+		for _, link := range parseLinkHeader(header) {
+			if !isPrefetchableLinkRel(link.rel) {
+				continue
+			}
+			ps.prefetchResource(ctx, link.target, resp)
+		}
+	}
+	return nil
+}
+
 func (ps *PrefetchServer) prefetchResource(ctx context.Context, targetUrlStr string, resp *http.Response) (err error) {
 	ctx, span := tracing.GetTracer(ctx, "prefetch").Start(ctx, targetUrlStr)
 	defer func() {
@@ -161,6 +206,19 @@ func (ps *PrefetchServer) prefetchResource(ctx context.Context, targetUrlStr str
 	}
 	defer resp.Body.Close()
 
+	if ps.pusher != nil {
+		if streamID, ok := parentStreamIDFromContext(ctx); ok {
+			err = ps.pusher.Push(ctx, streamID, req, resp)
+			if err == nil {
+				return nil
+			}
+			if !isPushDisabled(err) {
+				return fmt.Errorf("failed to push via PUSH_PROMISE: %w", err)
+			}
+			ps.logger.Debug(targetUrlStr, ": client disabled push, falling back to push channel")
+		}
+	}
+
 	if ps.channel != nil {
 		if err = ps.channel.Push(ctx, resp); err != nil {
 			return fmt.Errorf("failed to push resp: %w", err)